@@ -1,11 +1,7 @@
-// Package crudapi implements a RESTful JSON API exposing CRUD functionality relying on a custom storage.
-//
-// See http://en.wikipedia.org/wiki/RESTful and http://en.wikipedia.org/wiki/Create,_read,_update_and_delete for more information.
-//
-// An example can be found at: https://github.com/sauerbraten/crudapi#example
 package crudapi
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -16,39 +12,130 @@ import (
 )
 
 // New returns a handler mapping paths to the methods provided storage implementation.
+// It is a shorthand for NewWithGuard(storage, defaultGuard{}), which authenticates and
+// authorizes every request, but allows everyone to do everything.
 // If storage is nil, New panics.
 func New(storage Storage) http.Handler {
+	return NewWithGuard(storage, defaultGuard{})
+}
+
+// NewWithGuard returns a handler mapping paths to the methods provided by storage,
+// the same way New does, but consults guard on every request: Authenticate is
+// called first to derive a client identity from the request's query parameters,
+// then Authorize is called with that client, the action the request would
+// perform, and the request's route variables ("collection" and, where
+// applicable, "id"). A failed Authenticate yields a 401 Unauthorized, a failed
+// Authorize yields a 403 Forbidden, both carrying the guard's error message as
+// JSON. On success, the client identity is stashed on the request context and
+// can be retrieved with ClientFromContext.
+//
+// For each collection, only the routes matching the optional interfaces storage
+// satisfies (Creater, Getter, Lister, Updater, Deleter, CollectionDeleter) are
+// mounted; requesting an unmounted method on a path that has other methods
+// mounted yields the router's 405 Method Not Allowed, which carries no Allow
+// header. A 405 returned by storage itself (see NewMethodNotSupported) carries
+// an Allow header listing the methods that storage reports for the collection,
+// if storage implements CapabilitiesReporter. Where storage
+// satisfies the asynchronous counterpart of a write (AsyncCreater, AsyncUpdater,
+// AsyncDeleter, AsyncCollectionDeleter), that is mounted instead of its
+// synchronous equivalent, and the handler responds 202 Accepted with an
+// operation ID rather than blocking. If storage also satisfies
+// OperationStorage, GET /operations/{id}, DELETE /operations/{id} and
+// GET /operations are mounted to poll, cancel, and list those operations.
+// Whenever at least one route is mounted, GET /{collection}/_watch is mounted
+// alongside it, streaming change notifications for that collection as
+// server-sent events; storage can drive that stream itself by implementing
+// Watchable, and otherwise gets a default in-process broker fed by the
+// synchronous mutating handlers above; the asynchronous ones publish no events.
+// If storage is nil, or satisfies none of the optional interfaces, NewWithGuard panics.
+func NewWithGuard(storage Storage, guard Guard) http.Handler {
 	if storage == nil {
 		panic(errors.New("crudapi: storage is nil"))
 	}
 
+	if guard == nil {
+		guard = defaultGuard{}
+	}
+
+	notify, defaultBroker := newNotifier(storage)
+
 	h := chi.NewMux()
+	mounted := false
 
-	routes := map[string]map[string]handler{
-		"/{collection}": {
-			http.MethodGet:    getAll,
-			http.MethodPost:   create,
-			http.MethodDelete: deleteAll,
-		},
-		"/{collection}/{id}": {
-			http.MethodGet:    get,
-			http.MethodPut:    update,
-			http.MethodDelete: del,
-		},
-	}
-
-	for pattern, handlers := range routes {
-		for method, handler := range handlers {
-			h.Method(method, pattern, handler.withStorage(storage))
-		}
+	if s, ok := storage.(Lister); ok {
+		h.Method(http.MethodGet, "/{collection}", withGuard(getAll(s).withStorage(storage), guard, ActionGetAll))
+		mounted = true
+	}
+	if s, ok := storage.(AsyncCreater); ok {
+		h.Method(http.MethodPost, "/{collection}", withGuard(createAsync(s, notify).withStorage(storage), guard, ActionCreate))
+		mounted = true
+	} else if s, ok := storage.(Creater); ok {
+		h.Method(http.MethodPost, "/{collection}", withGuard(create(s, notify).withStorage(storage), guard, ActionCreate))
+		mounted = true
+	}
+	if s, ok := storage.(AsyncCollectionDeleter); ok {
+		h.Method(http.MethodDelete, "/{collection}", withGuard(deleteAllAsync(s, notify).withStorage(storage), guard, ActionDeleteAll))
+		mounted = true
+	} else if s, ok := storage.(CollectionDeleter); ok {
+		h.Method(http.MethodDelete, "/{collection}", withGuard(deleteAll(s, notify).withStorage(storage), guard, ActionDeleteAll))
+		mounted = true
+	}
+	if s, ok := storage.(Getter); ok {
+		h.Method(http.MethodGet, "/{collection}/{id}", withGuard(withETag(get(s).withStorage(storage), storage), guard, ActionGet))
+		mounted = true
+	}
+	if s, ok := storage.(AsyncUpdater); ok {
+		h.Method(http.MethodPut, "/{collection}/{id}", withGuard(withLockCheck(withPrecondition(updateAsync(s, notify).withStorage(storage), storage), storage), guard, ActionUpdate))
+		mounted = true
+	} else if s, ok := storage.(Updater); ok {
+		h.Method(http.MethodPut, "/{collection}/{id}", withGuard(withLockCheck(withPrecondition(update(s, notify).withStorage(storage), storage), storage), guard, ActionUpdate))
+		mounted = true
+	}
+	if s, ok := storage.(AsyncDeleter); ok {
+		h.Method(http.MethodDelete, "/{collection}/{id}", withGuard(withLockCheck(withPrecondition(delAsync(s, notify).withStorage(storage), storage), storage), guard, ActionDelete))
+		mounted = true
+	} else if s, ok := storage.(Deleter); ok {
+		h.Method(http.MethodDelete, "/{collection}/{id}", withGuard(withLockCheck(withPrecondition(del(s, notify).withStorage(storage), storage), storage), guard, ActionDelete))
+		mounted = true
+	}
+	if s, ok := storage.(Locker); ok {
+		h.Method(MethodLock, "/{collection}/{id}", withGuard(lock(s).withStorage(storage), guard, ActionLock))
+		h.Method(MethodUnlock, "/{collection}/{id}", withGuard(unlock(s).withStorage(storage), guard, ActionUnlock))
+		h.Method(MethodRefresh, "/{collection}/{id}", withGuard(refreshLock(s).withStorage(storage), guard, ActionRefreshLock))
+		mounted = true
+	}
+	if s, ok := storage.(OperationStorage); ok {
+		h.Method(http.MethodGet, "/operations", withGuard(listOperations(s).withStorage(storage), guard, ActionListOperations))
+		h.Method(http.MethodGet, "/operations/{id}", withGuard(getOperation(s).withStorage(storage), guard, ActionGetOperation))
+		h.Method(http.MethodDelete, "/operations/{id}", withGuard(cancelOperation(s).withStorage(storage), guard, ActionCancelOperation))
+		mounted = true
+	}
+
+	if mounted {
+		h.Method(http.MethodGet, "/{collection}/_watch", withGuard(watch(storage, defaultBroker), guard, ActionWatch))
+	}
+
+	if !mounted {
+		panic(errors.New("crudapi: storage satisfies none of crudapi's storage interfaces (Creater, Getter, Lister, Updater, Deleter, CollectionDeleter)"))
 	}
 
 	return h
 }
 
-type handler func(s Storage, collection, id string, query url.Values, body *json.Decoder) (statusCode int, resp response)
+// clientContextKey is the context.Context key under which the client identity
+// returned by Guard.Authenticate is stored.
+type clientContextKey struct{}
+
+// ClientFromContext returns the client identity a Guard derived via Authenticate
+// for this request, if any.
+func ClientFromContext(ctx context.Context) (client string, ok bool) {
+	client, ok = ctx.Value(clientContextKey{}).(string)
+	return
+}
+
+type handler func(ctx context.Context, collection, id string, query url.Values, body *json.Decoder) (statusCode int, resp response)
 
-func (h handler) withStorage(s Storage) http.HandlerFunc {
+func (h handler) withStorage(storage Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		collection := chi.URLParam(r, "collection")
 		id := chi.URLParam(r, "id")
@@ -56,58 +143,123 @@ func (h handler) withStorage(s Storage) http.HandlerFunc {
 		body := json.NewDecoder(r.Body)
 		defer r.Body.Close()
 
-		statusCode, resp := h(s, collection, id, query, body)
-
-		w.WriteHeader(statusCode)
+		statusCode, resp := h(r.Context(), collection, id, query, body)
 
-		if !resp.isEmpty() {
-			err := json.NewEncoder(w).Encode(resp)
-			if err != nil {
-				log.Println(err)
+		if statusCode == http.StatusMethodNotAllowed {
+			if reporter, ok := storage.(CapabilitiesReporter); ok {
+				setAllowHeader(w, reporter.Capabilities(collection))
 			}
 		}
+
+		writeResponse(w, statusCode, resp)
+	}
+}
+
+// withGuard wraps next with authentication and authorization for action, as
+// described on NewWithGuard. It is a plain function rather than a method on
+// http.HandlerFunc because http.HandlerFunc is declared in net/http, and Go
+// doesn't allow defining new methods on a type from another package.
+func withGuard(next http.HandlerFunc, guard Guard, action Action) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, client, errorMessage := guard.Authenticate(r.URL.Query())
+		if !ok {
+			writeResponse(w, http.StatusUnauthorized, response{ErrorMessage: errorMessage})
+			return
+		}
+
+		vars := map[string]string{
+			"collection": chi.URLParam(r, "collection"),
+			"id":         chi.URLParam(r, "id"),
+		}
+
+		ok, errorMessage = guard.Authorize(client, action, vars)
+		if !ok {
+			writeResponse(w, http.StatusForbidden, response{ErrorMessage: errorMessage})
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), clientContextKey{}, client)))
 	}
 }
 
-func create(storage Storage, collection, _ string, query url.Values, body *json.Decoder) (int, response) {
-	id, resp := storage.Create(collection, body, query)
-	return resp.StatusCode(), response{resp.Error(), id, nil}
+func writeResponse(w http.ResponseWriter, statusCode int, resp response) {
+	w.WriteHeader(statusCode)
+
+	if !resp.isEmpty() {
+		err := json.NewEncoder(w).Encode(resp)
+		if err != nil {
+			log.Println(err)
+		}
+	}
 }
 
-func getAll(storage Storage, collection, _ string, query url.Values, _ *json.Decoder) (int, response) {
-	resources, resp := storage.GetAll(collection, query)
-	return resp.StatusCode(), response{resp.Error(), "", resources}
+func create(storage Creater, notify notifyFunc) handler {
+	return func(ctx context.Context, collection, _ string, query url.Values, body *json.Decoder) (int, response) {
+		id, resp := storage.Create(ctx, collection, body, query)
+		if resp.StatusCode() == http.StatusCreated {
+			notify(ctx, collection, id, EventCreated)
+		}
+		return resp.StatusCode(), response{ErrorMessage: resp.Error(), ID: id}
+	}
+}
+
+func getAll(storage Lister) handler {
+	return func(ctx context.Context, collection, _ string, query url.Values, _ *json.Decoder) (int, response) {
+		resources, resp := storage.GetAll(ctx, collection, query)
+		return resp.StatusCode(), response{ErrorMessage: resp.Error(), Result: resources}
+	}
 }
 
-func get(storage Storage, collection, id string, query url.Values, _ *json.Decoder) (int, response) {
-	resource, resp := storage.Get(collection, id, query)
-	return resp.StatusCode(), response{resp.Error(), "", resource}
+func get(storage Getter) handler {
+	return func(ctx context.Context, collection, id string, query url.Values, _ *json.Decoder) (int, response) {
+		resource, resp := storage.Get(ctx, collection, id, query)
+		return resp.StatusCode(), response{ErrorMessage: resp.Error(), Result: resource}
+	}
 }
 
-func update(storage Storage, collection, id string, query url.Values, body *json.Decoder) (int, response) {
-	resp := storage.Update(collection, id, body, query)
-	return resp.StatusCode(), response{resp.Error(), "", nil}
+func update(storage Updater, notify notifyFunc) handler {
+	return func(ctx context.Context, collection, id string, query url.Values, body *json.Decoder) (int, response) {
+		resp := storage.Update(ctx, collection, id, body, query)
+		if resp.StatusCode() == http.StatusOK {
+			notify(ctx, collection, id, EventUpdated)
+		}
+		return resp.StatusCode(), response{ErrorMessage: resp.Error()}
+	}
 }
 
-func deleteAll(storage Storage, collection, _ string, query url.Values, _ *json.Decoder) (int, response) {
-	resp := storage.DeleteAll(collection, query)
-	return resp.StatusCode(), response{resp.Error(), "", nil}
+func deleteAll(storage CollectionDeleter, notify notifyFunc) handler {
+	return func(ctx context.Context, collection, _ string, query url.Values, _ *json.Decoder) (int, response) {
+		resp := storage.DeleteAll(ctx, collection, query)
+		if resp.StatusCode() == http.StatusOK {
+			notify(ctx, collection, "", EventDeleted)
+		}
+		return resp.StatusCode(), response{ErrorMessage: resp.Error()}
+	}
 }
 
 // delete() is a built-in function, thus del() is used here
-func del(storage Storage, collection, id string, query url.Values, _ *json.Decoder) (int, response) {
-	resp := storage.Delete(collection, id, query)
-	return resp.StatusCode(), response{resp.Error(), "", nil}
+func del(storage Deleter, notify notifyFunc) handler {
+	return func(ctx context.Context, collection, id string, query url.Values, _ *json.Decoder) (int, response) {
+		resp := storage.Delete(ctx, collection, id, query)
+		if resp.StatusCode() == http.StatusOK {
+			notify(ctx, collection, id, EventDeleted)
+		}
+		return resp.StatusCode(), response{ErrorMessage: resp.Error()}
+	}
 }
 
 type response struct {
 	ErrorMessage string      `json:"error,omitempty"`
 	ID           string      `json:"id,omitempty"`
+	Token        string      `json:"token,omitempty"`
+	OperationID  string      `json:"operationId,omitempty"`
 	Result       interface{} `json:"result,omitempty"`
 }
 
 func (r *response) isEmpty() bool {
 	return r.ErrorMessage == "" &&
 		r.ID == "" &&
+		r.Token == "" &&
+		r.OperationID == "" &&
 		r.Result == nil
 }
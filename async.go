@@ -0,0 +1,122 @@
+package crudapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// AsyncCreater is implemented by storages that create resources in the
+// background instead of blocking the request, e.g. because creation triggers a
+// slow bulk import. New responds 202 Accepted with the returned operation ID;
+// the client polls it via OperationStorage's GET /operations/{id}.
+type AsyncCreater interface {
+	CreateAsync(ctx context.Context, collection string, body *json.Decoder, query url.Values) (operationID string, resp StorageStatusResponse)
+}
+
+// AsyncUpdater is the asynchronous counterpart of Updater.
+type AsyncUpdater interface {
+	UpdateAsync(ctx context.Context, collection, id string, body *json.Decoder, query url.Values) (operationID string, resp StorageStatusResponse)
+}
+
+// AsyncDeleter is the asynchronous counterpart of Deleter.
+type AsyncDeleter interface {
+	DeleteAsync(ctx context.Context, collection, id string, query url.Values) (operationID string, resp StorageStatusResponse)
+}
+
+// AsyncCollectionDeleter is the asynchronous counterpart of CollectionDeleter,
+// useful for cascading deletes that touch a lot of data.
+type AsyncCollectionDeleter interface {
+	DeleteAllAsync(ctx context.Context, collection string, query url.Values) (operationID string, resp StorageStatusResponse)
+}
+
+// AsyncStorage groups all four asynchronous write capabilities. A storage may
+// instead satisfy only the individual Async* interfaces it needs; New prefers
+// the asynchronous form of an action over its synchronous counterpart when a
+// storage implements both.
+type AsyncStorage interface {
+	AsyncCreater
+	AsyncUpdater
+	AsyncDeleter
+	AsyncCollectionDeleter
+}
+
+// OperationStorage is implemented by storages that hand out operation IDs via
+// one or more Async* interfaces and want crudapi to expose polling endpoints
+// for them. The reference OperationManager implements the bookkeeping this
+// interface needs to expose.
+type OperationStorage interface {
+	// GetOperation returns the current state of the operation, or ok=false if it isn't known.
+	GetOperation(id string) (op Operation, ok bool)
+
+	// CancelOperation cancels a running operation.
+	CancelOperation(ctx context.Context, id string) StorageStatusResponse
+
+	// ListOperations returns all known operations.
+	ListOperations() []Operation
+}
+
+// The asynchronous handlers publish no change events: the work finishes after
+// the response is sent, and OperationManager-backed storages report that
+// transition only through GetOperation. With the default broker, _watch
+// therefore shows no changes made through these handlers. Storages that want
+// _watch to reflect async results can publish via a custom Watchable
+// implementation instead.
+
+func createAsync(storage AsyncCreater, _ notifyFunc) handler {
+	return func(ctx context.Context, collection, _ string, query url.Values, body *json.Decoder) (int, response) {
+		operationID, resp := storage.CreateAsync(ctx, collection, body, query)
+		return resp.StatusCode(), response{ErrorMessage: resp.Error(), OperationID: operationID}
+	}
+}
+
+func updateAsync(storage AsyncUpdater, _ notifyFunc) handler {
+	return func(ctx context.Context, collection, id string, query url.Values, body *json.Decoder) (int, response) {
+		operationID, resp := storage.UpdateAsync(ctx, collection, id, body, query)
+		return resp.StatusCode(), response{ErrorMessage: resp.Error(), OperationID: operationID}
+	}
+}
+
+func delAsync(storage AsyncDeleter, _ notifyFunc) handler {
+	return func(ctx context.Context, collection, id string, query url.Values, _ *json.Decoder) (int, response) {
+		operationID, resp := storage.DeleteAsync(ctx, collection, id, query)
+		return resp.StatusCode(), response{ErrorMessage: resp.Error(), OperationID: operationID}
+	}
+}
+
+func deleteAllAsync(storage AsyncCollectionDeleter, _ notifyFunc) handler {
+	return func(ctx context.Context, collection, _ string, query url.Values, _ *json.Decoder) (int, response) {
+		operationID, resp := storage.DeleteAllAsync(ctx, collection, query)
+		return resp.StatusCode(), response{ErrorMessage: resp.Error(), OperationID: operationID}
+	}
+}
+
+func getOperation(storage OperationStorage) handler {
+	return func(_ context.Context, _, id string, _ url.Values, _ *json.Decoder) (int, response) {
+		op, ok := storage.GetOperation(id)
+		if !ok {
+			resp := operationNotFound(id)
+			return resp.StatusCode(), response{ErrorMessage: resp.Error()}
+		}
+
+		return http.StatusOK, response{Result: op}
+	}
+}
+
+func cancelOperation(storage OperationStorage) handler {
+	return func(ctx context.Context, _, id string, _ url.Values, _ *json.Decoder) (int, response) {
+		resp := storage.CancelOperation(ctx, id)
+		return resp.StatusCode(), response{ErrorMessage: resp.Error()}
+	}
+}
+
+func listOperations(storage OperationStorage) handler {
+	return func(_ context.Context, _, _ string, _ url.Values, _ *json.Decoder) (int, response) {
+		return http.StatusOK, response{Result: storage.ListOperations()}
+	}
+}
+
+func operationNotFound(id string) StorageStatusResponse {
+	return failureResponse{"operation '" + id + "' not found", http.StatusNotFound}
+}
@@ -0,0 +1,142 @@
+package crudapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAsyncStorage implements only AsyncCreater and OperationStorage, to
+// exercise the operations subsystem in isolation from MapStorage's
+// synchronous routes.
+type fakeAsyncStorage struct {
+	mu   sync.Mutex
+	next uint64
+	ops  *OperationManager
+}
+
+func newFakeAsyncStorage() *fakeAsyncStorage {
+	return &fakeAsyncStorage{ops: NewOperationManager(time.Minute)}
+}
+
+func (s *fakeAsyncStorage) CreateAsync(ctx context.Context, _ string, body *json.Decoder, _ url.Values) (string, StorageStatusResponse) {
+	var resource map[string]interface{}
+	if err := body.Decode(&resource); err != nil {
+		return "", malformedJSON(err)
+	}
+
+	operationID := s.ops.Start(ctx, func(ctx context.Context) (interface{}, error) {
+		s.mu.Lock()
+		s.next++
+		id := strconv.FormatUint(s.next, 10)
+		s.mu.Unlock()
+
+		return id, nil
+	})
+
+	return operationID, success(http.StatusAccepted)
+}
+
+func (s *fakeAsyncStorage) GetOperation(id string) (Operation, bool) {
+	return s.ops.Get(id)
+}
+
+func (s *fakeAsyncStorage) CancelOperation(_ context.Context, id string) StorageStatusResponse {
+	if !s.ops.Cancel(id) {
+		return failureResponse{"operation '" + id + "' not found", http.StatusNotFound}
+	}
+	return success(http.StatusOK)
+}
+
+func (s *fakeAsyncStorage) ListOperations() []Operation {
+	return s.ops.List()
+}
+
+func waitForOperation(t *testing.T, srv *httptest.Server, operationID string) Operation {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(srv.URL + "/operations/" + operationID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body response
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		op, ok := body.Result.(map[string]interface{})
+		if !ok {
+			t.Fatalf("GET /operations/%s did not return an operation, got %#v", operationID, body.Result)
+		}
+
+		if status := op["status"]; status != string(OperationPending) && status != string(OperationRunning) {
+			return Operation{ID: operationID, Status: OperationStatus(status.(string))}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("operation %s did not finish within the deadline", operationID)
+	return Operation{}
+}
+
+func TestAsyncCreateAndPoll(t *testing.T) {
+	srv := httptest.NewServer(New(newFakeAsyncStorage()))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/artists", "application/json", strings.NewReader(`{"name":"test"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created response
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("async create: got status %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+	if created.OperationID == "" {
+		t.Fatal("async create did not return an operation ID")
+	}
+
+	op := waitForOperation(t, srv, created.OperationID)
+	if op.Status != OperationSuccess {
+		t.Fatalf("operation finished with status %q, want %q", op.Status, OperationSuccess)
+	}
+}
+
+func TestCancelUnknownOperation(t *testing.T) {
+	srv := httptest.NewServer(New(newFakeAsyncStorage()))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodDelete, srv.URL+"/operations/does-not-exist", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("cancel of an unknown operation: got status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
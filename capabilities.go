@@ -0,0 +1,66 @@
+package crudapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CapabilitiesReporter is implemented by storages that expose different sets of
+// supported actions per collection, such as a registry proxying to several
+// heterogeneous sub-storages. When a Storage implements it, New consults it to
+// populate the Allow header of 405 responses returned via
+// NewMethodNotSupported.
+type CapabilitiesReporter interface {
+	// Capabilities returns the actions supported for the given collection.
+	Capabilities(collection string) []Action
+}
+
+// actionMethod maps an Action to the HTTP method used to trigger it.
+var actionMethod = map[Action]string{
+	ActionCreate:      http.MethodPost,
+	ActionGet:         http.MethodGet,
+	ActionGetAll:      http.MethodGet,
+	ActionUpdate:      http.MethodPut,
+	ActionDelete:      http.MethodDelete,
+	ActionDeleteAll:   http.MethodDelete,
+	ActionLock:        MethodLock,
+	ActionUnlock:      MethodUnlock,
+	ActionRefreshLock: MethodRefresh,
+}
+
+// NewMethodNotSupported returns a StorageStatusResponse describing that action
+// is not supported for collection. Storages that mount a route by satisfying
+// the corresponding narrow interface (Creater, Getter, ...) but still want to
+// refuse that action for specific collections at runtime can return this from
+// the relevant method; the handler responds with 405 Method Not Allowed.
+func NewMethodNotSupported(collection string, action Action) StorageStatusResponse {
+	return &methodNotSupportedResponse{collection, action}
+}
+
+type methodNotSupportedResponse struct {
+	collection string
+	action     Action
+}
+
+func (r *methodNotSupportedResponse) Error() string {
+	return fmt.Sprintf("%s is not supported for collection '%s'", r.action, r.collection)
+}
+
+func (r *methodNotSupportedResponse) StatusCode() int {
+	return http.StatusMethodNotAllowed
+}
+
+// setAllowHeader sets the Allow header to the HTTP methods corresponding to actions.
+func setAllowHeader(w http.ResponseWriter, actions []Action) {
+	methods := make([]string, 0, len(actions))
+	for _, action := range actions {
+		if method, ok := actionMethod[action]; ok {
+			methods = append(methods, method)
+		}
+	}
+
+	if len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+	}
+}
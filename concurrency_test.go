@@ -0,0 +1,135 @@
+package crudapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func createTestResource(t *testing.T, srv *httptest.Server, collection string) (id, etag string) {
+	t.Helper()
+
+	resp, err := http.Post(srv.URL+"/"+collection, "application/json", strings.NewReader(`{"name":"test"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body response
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	get, err := http.Get(srv.URL + "/" + collection + "/" + body.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer get.Body.Close()
+
+	return body.ID, get.Header.Get("ETag")
+}
+
+func TestPreconditionFailed(t *testing.T) {
+	storage := NewMapStorage()
+	storage.AddMap("artists")
+	srv := httptest.NewServer(New(storage))
+	defer srv.Close()
+
+	id, etag := createTestResource(t, srv, "artists")
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/artists/"+id, strings.NewReader(`{"name":"updated"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-Match", etag+"-stale")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("update with a stale If-Match: got status %d, want %d", resp.StatusCode, http.StatusPreconditionFailed)
+	}
+
+	req2, err := http.NewRequest(http.MethodPut, srv.URL+"/artists/"+id, strings.NewReader(`{"name":"updated"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req2.Header.Set("If-Match", etag)
+
+	resp2, err := http.DefaultClient.Do(req2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusOK && resp2.StatusCode != http.StatusAccepted {
+		t.Fatalf("update with the current If-Match: got status %d, want 200 or 202", resp2.StatusCode)
+	}
+}
+
+func TestLocking(t *testing.T) {
+	storage := NewMapStorage()
+	storage.AddMap("artists")
+	srv := httptest.NewServer(New(storage))
+	defer srv.Close()
+
+	id, _ := createTestResource(t, srv, "artists")
+
+	lockReq, err := http.NewRequest(MethodLock, srv.URL+"/artists/"+id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockResp, err := http.DefaultClient.Do(lockReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lockResp.Body.Close()
+
+	var lockBody response
+	if err := json.NewDecoder(lockResp.Body).Decode(&lockBody); err != nil {
+		t.Fatal(err)
+	}
+	if lockBody.Token == "" {
+		t.Fatal("LOCK did not return a token")
+	}
+
+	unauthorized, err := http.NewRequest(http.MethodPut, srv.URL+"/artists/"+id, strings.NewReader(`{"name":"updated"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(unauthorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusLocked {
+		t.Fatalf("update of a locked resource without the lock token: got status %d, want %d", resp.StatusCode, http.StatusLocked)
+	}
+
+	authorized, err := http.NewRequest(http.MethodPut, srv.URL+"/artists/"+id, bytes.NewReader([]byte(`{"name":"updated"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized.Header.Set("X-Lock-Token", lockBody.Token)
+
+	resp2, err := http.DefaultClient.Do(authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	io.Copy(io.Discard, resp2.Body)
+
+	if resp2.StatusCode != http.StatusOK && resp2.StatusCode != http.StatusAccepted {
+		t.Fatalf("update of a locked resource with the matching lock token: got status %d, want 200 or 202", resp2.StatusCode)
+	}
+}
@@ -1,68 +1,62 @@
 package crudapi
 
 import (
-	"github.com/gorilla/mux"
-	"log"
+	"context"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 )
 
-func TestAPI(t *testing.T) {
-
+// fakeCapStorage is a minimal storage used to test per-collection capability
+// negotiation: it refuses ActionCreate for the "readonly" collection at
+// runtime and reports that via CapabilitiesReporter, even though it satisfies
+// Creater for every collection.
+type fakeCapStorage struct{}
+
+func (fakeCapStorage) Capabilities(collection string) []Action {
+	if collection == "readonly" {
+		return []Action{ActionGet, ActionGetAll}
+	}
+	return []Action{ActionCreate, ActionGet, ActionGetAll}
 }
 
-// Put this code into a main.go, fix imports and stuff.
-// When the server is running, try the following commands
-//
-// curl -i -X POST -d '{"id":"gorillaz","resource":{"name":"Gorillaz","albums":["the-fall"]}}' http://localhost:8080/artist
-//
-// curl -i -X POST -d '{"id":"plastic-beach","resource":{"title":"Plastic Beach","by":"gorillaz","songs":["on-melancholy-hill","stylo"]}}' http://localhost:8080/artist
-//
-// curl -i -X GET http://localhost:8080/artist/gorillaz
-//
-// curl -i -X PUT -d '{"name":"Gorillaz","albums":["plastic-beach","the-fall"]}' http://localhost:8080/artist/gorillaz
-//
-// Note the returned HTTP codes: '201 Created' when POSTing, '200 OK' when GETting and PUTting.
-// There is also '404 Not Found' if either the kind of data you are posting (for example 'artist' and 'album' in the URLs) is unkown or there is no resource with the specified id ('gorillaz' in the GET request). In that case a JSON object containing an "error" field is returned, i.e.: {"error":"resource not found"} or {"error":"kind not found"}.
-// '400 Bad Request' is returned when either the POSTed or PUTted JSON data is malformed and cannot be parsed or when you are POSTing/PUTting without an "id" field in the top-level JSON object.
-// '409 Conflict' and {"error":"resource already exists"} as response means, well, that you POSTed a resource with an "id" that is already in use.
-//
-// Server responses are always a JSON object, containing one or more of the following fields:
-// "error": specifies the error that occured, if any
-// "id": the ID of the newly created or updated resource
-// "resource": the requested resource (used when GETting resources)
-//
-func ExampleAPI() {
-	// storage
-	s := NewMapStorage()
-	s.AddKind("artist")
-	s.AddKind("album")
-
-	api := NewAPI(s)
-
-	// routes
-	r := mux.NewRouter()
-	r.StrictSlash(true)
-
-	/*
-		POST creates,
-		GET returns,
-		PUT updates,
-		DELETE deletes
-	*/
+func (fakeCapStorage) Create(_ context.Context, collection string, _ *json.Decoder, _ url.Values) (string, StorageStatusResponse) {
+	if collection == "readonly" {
+		return "", NewMethodNotSupported(collection, ActionCreate)
+	}
+	return "id1", success(http.StatusCreated)
+}
 
-	post := r.Methods("POST").Subrouter()
-	get := r.Methods("GET").Subrouter()
-	put := r.Methods("PUT").Subrouter()
-	del := r.Methods("DELETE").Subrouter()
+func (fakeCapStorage) Get(_ context.Context, _, id string, _ url.Values) (interface{}, StorageStatusResponse) {
+	return map[string]interface{}{"id": id}, success(http.StatusOK)
+}
 
-	// crud
-	post.HandleFunc("/{kind}", api.Create)
-	get.HandleFunc("/{kind}/{id}", api.Get)
-	put.HandleFunc("/{kind}/{id}", api.Update)
-	del.HandleFunc("/{kind}/{id}", api.Delete)
+func (fakeCapStorage) GetAll(_ context.Context, _ string, _ url.Values) ([]interface{}, StorageStatusResponse) {
+	return nil, success(http.StatusOK)
+}
 
-	// start listening
-	log.Println("server listening on localhost:8080")
-	http.ListenAndServe(":8080", r)
+func TestCapabilityNegotiation(t *testing.T) {
+	srv := httptest.NewServer(New(fakeCapStorage{}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/readonly", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST to a collection refusing create: got status %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	allow := resp.Header.Get("Allow")
+	if !strings.Contains(allow, http.MethodGet) {
+		t.Errorf("Allow header %q does not list GET, which the collection does support", allow)
+	}
+	if strings.Contains(allow, http.MethodPost) {
+		t.Errorf("Allow header %q lists POST, which the collection refused", allow)
+	}
 }
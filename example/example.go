@@ -13,7 +13,7 @@ func hello(resp http.ResponseWriter, req *http.Request) {
 
 func main() {
 	// storage
-	storage := NewMapStorage()
+	storage := crudapi.NewMapStorage()
 	storage.AddMap("artists")
 	storage.AddMap("albums")
 
@@ -16,7 +16,7 @@ func (mg MapGuard) Authenticate(params url.Values) (ok bool, client string, erro
 }
 
 func (mg MapGuard) Authorize(client string, action crudapi.Action, vars map[string]string) (ok bool, errorMessage string) {
-	for _, validAction := range mg.ValidActions[vars["kind"]] {
+	for _, validAction := range mg.ValidActions[vars["collection"]] {
 		if validAction == action {
 			ok = true
 			return
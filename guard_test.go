@@ -0,0 +1,74 @@
+package crudapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// fakeGuard authenticates clients present in clients and only authorizes the
+// action recorded for them, to exercise withGuard's 401/403 handling.
+type fakeGuard struct {
+	clients map[string]Action // client -> the one action it's authorized to perform
+}
+
+func (g fakeGuard) Authenticate(params url.Values) (ok bool, client string, errorMessage string) {
+	client = params.Get("client")
+	if _, known := g.clients[client]; !known {
+		return false, "", "unknown client"
+	}
+	return true, client, ""
+}
+
+func (g fakeGuard) Authorize(client string, action Action, _ map[string]string) (ok bool, errorMessage string) {
+	if g.clients[client] != action {
+		return false, "action not allowed for this client"
+	}
+	return true, ""
+}
+
+func TestGuardAuthentication(t *testing.T) {
+	guard := fakeGuard{clients: map[string]Action{"alice": ActionGetAll}}
+	srv := httptest.NewServer(NewWithGuard(NewMapStorage(), guard))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/artists?client=mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("request from an unknown client: got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestGuardAuthorization(t *testing.T) {
+	guard := fakeGuard{clients: map[string]Action{"alice": ActionGetAll}}
+	storage := NewMapStorage()
+	storage.AddMap("artists")
+	srv := httptest.NewServer(NewWithGuard(storage, guard))
+	defer srv.Close()
+
+	// alice may GetAll, but not Create.
+	resp, err := http.Post(srv.URL+"/artists?client=alice", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("create by a client only authorized to list: got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	resp2, err := http.Get(srv.URL + "/artists?client=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("list by a client authorized to list: got status %d, want %d", resp2.StatusCode, http.StatusOK)
+	}
+}
@@ -1,184 +1,315 @@
 package crudapi
 
 import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/url"
 	"strconv"
 	"sync"
 	"time"
 )
 
-// MapStorage is a basic storage using maps. Thus, it is not persistent! It is meant as an example and for testing purposes.
-// MapStorage is thread-safe, as any Storage implementation should be, since CRUD handlers run in parrallel as well.
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// lockSweepInterval is how often MapStorage cleans up expired locks.
+const lockSweepInterval = time.Second
+
+var (
+	collectionNotFound = failureResponse{"collection not found", http.StatusNotFound}
+	resourceNotFound   = failureResponse{"resource not found", http.StatusNotFound}
+	resourceLocked     = failureResponse{"resource is locked", http.StatusLocked}
+)
+
+func success(statusCode int) StorageStatusResponse {
+	return failureResponse{"", statusCode}
+}
+
+func malformedJSON(err error) StorageStatusResponse {
+	return failureResponse{"malformed JSON: " + err.Error(), http.StatusBadRequest}
+}
+
+// mapLock is an application-level lock held on a single resource, as used by MapStorage.
+type mapLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+func (l *mapLock) expired() bool {
+	return time.Now().After(l.expiresAt)
+}
+
+// MapStorage is a basic storage using maps. Thus, it is not persistent! It is
+// meant as a reference implementation and for testing purposes. Besides the
+// CRUD interfaces (Creater, Getter, Lister, Updater, Deleter and
+// CollectionDeleter), it implements Versioned and Locker, backed by a
+// version counter per resource and an in-memory map of id -> lock, swept
+// periodically to expire stale locks. It deliberately does not also implement
+// AsyncStorage: New prefers the asynchronous form of an action over its
+// synchronous counterpart when a storage implements both, and MapStorage's
+// whole point is to be a synchronous reference implementation.
+// MapStorage is thread-safe, as any Storage implementation should be, since CRUD handlers run in parallel as well.
 type MapStorage struct {
-	sync.RWMutex
-	data map[string]map[string]interface{}
+	mu       sync.RWMutex
+	data     map[string]map[string]interface{}
+	versions map[string]map[string]uint64
+	locks    map[string]map[string]*mapLock
 }
 
-// Returns an initialized MapStorage
-func NewMapStorage() MapStorage {
-	return MapStorage{sync.RWMutex{}, make(map[string]map[string]interface{})}
+// NewMapStorage returns an initialized MapStorage and starts its lock sweeper goroutine.
+func NewMapStorage() *MapStorage {
+	ms := &MapStorage{
+		data:     make(map[string]map[string]interface{}),
+		versions: make(map[string]map[string]uint64),
+		locks:    make(map[string]map[string]*mapLock),
+	}
+
+	go ms.sweepExpiredLocks()
+
+	return ms
 }
 
-// Adds a interface{} to the root level map. Equivalent to a database table.
-func (ms MapStorage) AddMap(kind string) StorageError {
-	// check if kind already exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
-	if ok {
-		return KindExists
+// sweepExpiredLocks periodically removes locks past their TTL, so a client that
+// never calls UNLOCK doesn't keep a resource locked forever.
+func (ms *MapStorage) sweepExpiredLocks() {
+	for range time.Tick(lockSweepInterval) {
+		ms.mu.Lock()
+		for collection, locks := range ms.locks {
+			for id, l := range locks {
+				if l.expired() {
+					delete(locks, id)
+				}
+			}
+			if len(locks) == 0 {
+				delete(ms.locks, collection)
+			}
+		}
+		ms.mu.Unlock()
 	}
+}
 
-	ms.Lock()
-	ms.data[kind] = make(map[string]interface{})
-	ms.Unlock()
+// AddMap adds a collection. Equivalent to a database table.
+func (ms *MapStorage) AddMap(collection string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data[collection] = make(map[string]interface{})
+	ms.versions[collection] = make(map[string]uint64)
+	ms.locks[collection] = make(map[string]*mapLock)
+}
 
-	return None
+// DeleteMap reverts AddMap.
+func (ms *MapStorage) DeleteMap(collection string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.data, collection)
+	delete(ms.versions, collection)
+	delete(ms.locks, collection)
 }
 
-// Reverts AddMap().
-func (ms MapStorage) DeleteMap(kind string) StorageError {
-	// make sure kind exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
-	if !ok {
-		return KindNotFound
+func (ms *MapStorage) collectionExists(collection string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	_, ok := ms.data[collection]
+
+	return ok
+}
+
+func (ms *MapStorage) resourceExists(collection, id string) (interface{}, bool) {
+	if !ms.collectionExists(collection) {
+		return nil, false
 	}
 
-	ms.Lock()
-	delete(ms.data, kind)
-	ms.Unlock()
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	resource, ok := ms.data[collection][id]
 
-	return None
+	return resource, ok
 }
 
-func (ms MapStorage) Create(kind string, resource interface{}) (id string, err StorageError) {
-	// make sure kind exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
-	if !ok {
-		return
+// Create implements Creater.
+func (ms *MapStorage) Create(_ context.Context, collection string, body *json.Decoder, _ url.Values) (string, StorageStatusResponse) {
+	if !ms.collectionExists(collection) {
+		return "", collectionNotFound
+	}
+
+	var resource map[string]interface{}
+	if err := body.Decode(&resource); err != nil {
+		return "", malformedJSON(err)
 	}
 
-	// make (pesudo-random) ID
-	id = strconv.FormatInt(time.Now().Unix(), 10)
+	id := strconv.FormatInt(rand.Int63(), 10)
 
-	// create nil entry for the new ID
-	ms.Lock()
-	ms.data[kind][id] = resource
-	ms.Unlock()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.data[collection][id] = resource
+	ms.versions[collection][id] = 1
 
-	return
+	return id, success(http.StatusCreated)
 }
 
-func (ms MapStorage) Get(kind, id string) (resource interface{}, err StorageError) {
-	// make sure kind exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
+// Get implements Getter.
+func (ms *MapStorage) Get(_ context.Context, collection, id string, _ url.Values) (interface{}, StorageStatusResponse) {
+	resource, ok := ms.resourceExists(collection, id)
 	if !ok {
-		err = KindNotFound
-		return
+		return nil, resourceNotFound
 	}
 
-	// make sure a resource with this ID exists
-	ms.RLock()
-	resource, ok = ms.data[kind][id]
-	ms.RUnlock()
-	if !ok {
-		err = ResourceNotFound
-		return
+	return resource, success(http.StatusOK)
+}
+
+// GetAll implements Lister.
+func (ms *MapStorage) GetAll(_ context.Context, collection string, _ url.Values) ([]interface{}, StorageStatusResponse) {
+	if !ms.collectionExists(collection) {
+		return nil, collectionNotFound
 	}
 
-	return
+	var resources []interface{}
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	for _, resource := range ms.data[collection] {
+		resources = append(resources, resource)
+	}
+
+	return resources, success(http.StatusOK)
 }
 
-func (ms MapStorage) GetAll(kind string) (resources []interface{}, err StorageError) {
-	// make sure kind exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
-	if !ok {
-		err = KindNotFound
-		return
+// Update implements Updater.
+func (ms *MapStorage) Update(_ context.Context, collection, id string, body *json.Decoder, _ url.Values) StorageStatusResponse {
+	if _, ok := ms.resourceExists(collection, id); !ok {
+		return resourceNotFound
 	}
 
-	// collect all values in the kind's map in a slice
-	ms.RLock()
-	for _, resource := range ms.data[kind] {
-		resources = append(resources, resource)
+	var resource map[string]interface{}
+	if err := body.Decode(&resource); err != nil {
+		return malformedJSON(err)
 	}
-	ms.RUnlock()
 
-	return
+	ms.mu.Lock()
+	ms.data[collection][id] = resource
+	ms.versions[collection][id]++
+	ms.mu.Unlock()
+
+	return success(http.StatusOK)
 }
 
-func (ms MapStorage) Update(kind, id string, resource interface{}) StorageError {
-	// make sure kind exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
-	if !ok {
-		return KindNotFound
+// Delete implements Deleter.
+func (ms *MapStorage) Delete(_ context.Context, collection, id string, _ url.Values) StorageStatusResponse {
+	if _, ok := ms.resourceExists(collection, id); !ok {
+		return resourceNotFound
 	}
 
-	// make sure the resource exists
-	ms.RLock()
-	_, ok = ms.data[kind][id]
-	ms.RUnlock()
-	if !ok {
-		return ResourceNotFound
+	ms.deleteResource(collection, id)
+
+	return success(http.StatusOK)
+}
+
+func (ms *MapStorage) deleteResource(collection, id string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.data[collection], id)
+	delete(ms.versions[collection], id)
+	delete(ms.locks[collection], id)
+}
+
+// DeleteAll implements CollectionDeleter.
+func (ms *MapStorage) DeleteAll(_ context.Context, collection string, _ url.Values) StorageStatusResponse {
+	if !ms.collectionExists(collection) {
+		return collectionNotFound
 	}
 
-	// update resource
-	ms.Lock()
-	ms.data[kind][id] = resource
-	ms.Unlock()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for id := range ms.data[collection] {
+		delete(ms.data[collection], id)
+		delete(ms.versions[collection], id)
+		delete(ms.locks[collection], id)
+	}
 
-	return None
+	return success(http.StatusOK)
 }
 
-func (ms MapStorage) Delete(kind, id string) StorageError {
-	// make sure kind exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
-	if !ok {
-		return KindNotFound
+// ETag implements Versioned, returning the resource's version counter as its ETag.
+func (ms *MapStorage) ETag(_ context.Context, collection, id string) (string, bool) {
+	if !ms.collectionExists(collection) {
+		return "", false
 	}
 
-	// make sure the resource exists
-	ms.RLock()
-	_, ok = ms.data[kind][id]
-	ms.RUnlock()
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	version, ok := ms.versions[collection][id]
 	if !ok {
-		return ResourceNotFound
+		return "", false
+	}
+
+	return strconv.FormatUint(version, 10), true
+}
+
+// SetLock implements Locker.
+func (ms *MapStorage) SetLock(_ context.Context, collection, id string, ttl time.Duration) (string, StorageStatusResponse) {
+	if _, ok := ms.resourceExists(collection, id); !ok {
+		return "", resourceNotFound
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if l, ok := ms.locks[collection][id]; ok && !l.expired() {
+		return "", resourceLocked
+	}
+
+	// the sweeper drops a collection's lock map once it is empty
+	if ms.locks[collection] == nil {
+		ms.locks[collection] = make(map[string]*mapLock)
 	}
 
-	// delete resource
-	ms.Lock()
-	delete(ms.data[kind], id)
-	ms.Unlock()
+	token := strconv.FormatInt(rand.Int63(), 10)
+	ms.locks[collection][id] = &mapLock{token: token, expiresAt: time.Now().Add(ttl)}
 
-	return None
+	return token, success(http.StatusOK)
 }
 
-func (ms MapStorage) DeleteAll(kind string) StorageError {
-	// make sure kind exists
-	ms.RLock()
-	_, ok := ms.data[kind]
-	ms.RUnlock()
-	if !ok {
-		return KindNotFound
+// RefreshLock implements Locker.
+func (ms *MapStorage) RefreshLock(_ context.Context, collection, id, token string, ttl time.Duration) StorageStatusResponse {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	l, ok := ms.locks[collection][id]
+	if !ok || l.expired() || l.token != token {
+		return resourceLocked
+	}
+
+	l.expiresAt = time.Now().Add(ttl)
+
+	return success(http.StatusOK)
+}
+
+// Unlock implements Locker.
+func (ms *MapStorage) Unlock(_ context.Context, collection, id, token string) StorageStatusResponse {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	l, ok := ms.locks[collection][id]
+	if !ok || l.token != token {
+		return resourceLocked
 	}
 
-	// delete resources
-	ms.Lock()
-	for id := range ms.data[kind] {
-		delete(ms.data[kind], id)
+	delete(ms.locks[collection], id)
+
+	return success(http.StatusOK)
+}
+
+// CheckLock implements Locker.
+func (ms *MapStorage) CheckLock(_ context.Context, collection, id string) (string, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	l, ok := ms.locks[collection][id]
+	if !ok || l.expired() {
+		return "", false
 	}
-	ms.Unlock()
 
-	return None
+	return l.token, true
 }
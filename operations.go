@@ -0,0 +1,160 @@
+package crudapi
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OperationStatus describes the lifecycle state of an Operation.
+type OperationStatus string
+
+const (
+	OperationPending OperationStatus = "pending"
+	OperationRunning OperationStatus = "running"
+	OperationSuccess OperationStatus = "success"
+	OperationFailure OperationStatus = "failure"
+)
+
+// Operation describes the current state of a long-running action started
+// through an OperationManager.
+type Operation struct {
+	ID     string          `json:"id"`
+	Status OperationStatus `json:"status"`
+	Result interface{}     `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// OperationManager runs long-running work in the background and tracks its
+// state so it can be polled and cancelled. It is meant to be used by Storage
+// implementations that satisfy AsyncStorage and OperationStorage; crudapi's
+// HTTP layer never talks to it directly.
+type OperationManager struct {
+	ttl time.Duration
+
+	mu   sync.Mutex
+	next uint64
+	ops  map[string]*trackedOperation
+}
+
+type trackedOperation struct {
+	op     Operation
+	cancel context.CancelFunc
+}
+
+// detachedContext carries ctx's values but is never cancelled or deadlined by
+// it, so work started from a request can outlive that request.
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+// NewOperationManager returns an OperationManager that forgets a completed
+// operation ttl after it finished.
+func NewOperationManager(ttl time.Duration) *OperationManager {
+	return &OperationManager{
+		ttl: ttl,
+		ops: make(map[string]*trackedOperation),
+	}
+}
+
+// Start runs fn in a new goroutine with a context derived from ctx that is
+// cancelled when the returned operation is cancelled via Cancel, and returns
+// the ID of the resulting Operation.
+func (om *OperationManager) Start(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) string {
+	ctx, cancel := context.WithCancel(detachedContext{ctx})
+
+	om.mu.Lock()
+	om.next++
+	id := strconv.FormatUint(om.next, 10)
+	om.ops[id] = &trackedOperation{
+		op:     Operation{ID: id, Status: OperationPending},
+		cancel: cancel,
+	}
+	om.mu.Unlock()
+
+	go om.run(ctx, id, fn)
+
+	return id
+}
+
+func (om *OperationManager) run(ctx context.Context, id string, fn func(ctx context.Context) (interface{}, error)) {
+	om.setStatus(id, OperationRunning, nil, "")
+
+	result, err := fn(ctx)
+
+	if err != nil {
+		om.setStatus(id, OperationFailure, nil, err.Error())
+	} else {
+		om.setStatus(id, OperationSuccess, result, "")
+	}
+
+	time.AfterFunc(om.ttl, func() { om.forget(id) })
+}
+
+func (om *OperationManager) setStatus(id string, status OperationStatus, result interface{}, errorMessage string) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	tracked, ok := om.ops[id]
+	if !ok {
+		return
+	}
+
+	tracked.op.Status = status
+	tracked.op.Result = result
+	tracked.op.Error = errorMessage
+}
+
+func (om *OperationManager) forget(id string) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	delete(om.ops, id)
+}
+
+// Get returns the current state of the operation identified by id.
+func (om *OperationManager) Get(id string) (Operation, bool) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	tracked, ok := om.ops[id]
+	if !ok {
+		return Operation{}, false
+	}
+
+	return tracked.op, true
+}
+
+// Cancel cancels the operation identified by id. It reports wether the
+// operation was found; the cancellation itself is cooperative, so the
+// operation's status only becomes OperationFailure once fn observes ctx.Done().
+func (om *OperationManager) Cancel(id string) bool {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	tracked, ok := om.ops[id]
+	if !ok {
+		return false
+	}
+
+	tracked.cancel()
+
+	return true
+}
+
+// List returns all operations the manager currently knows about.
+func (om *OperationManager) List() []Operation {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	ops := make([]Operation, 0, len(om.ops))
+	for _, tracked := range om.ops {
+		ops = append(ops, tracked.op)
+	}
+
+	return ops
+}
@@ -1,6 +1,7 @@
 package crudapi // import "gopkg.in/sauerbraten/crudapi.v2"
 
 import (
+	"context"
 	"encoding/json"
 	"net/url"
 )
@@ -11,28 +12,55 @@ type StorageStatusResponse interface {
 	StatusCode() int // the HTTP status code that is returned to the client
 }
 
-// Storage describes the methods required for a storage to be used with the API type.
-// When implementing your own storage, make sure that the methods are thread-safe.
+// Storage is implemented by any storage backend usable with New. It carries no
+// required methods itself: a storage opts into individual CRUD actions by
+// satisfying the narrower Creater, Getter, Lister, Updater, Deleter and/or
+// CollectionDeleter interfaces below. New inspects the concrete value passed to
+// it and only mounts routes for the interfaces it actually satisfies, so a
+// read-only or append-only backend doesn't need to stub out the actions it
+// doesn't support.
 //
+// Every method receives the request's context, which is cancelled when the
+// client disconnects; long-running implementations should watch it.
 // When applicable, the request body is passed in as a JSON decoder which can be used to translate
 // the input into arbitrary types.
 // As last parameter, each function gets the URL query parameters to allow for filtering etc.
-type Storage interface {
+//
+// When implementing your own storage, make sure that the methods are thread-safe.
+type Storage interface{}
+
+// Creater is implemented by storages that can create a resource in a collection.
+type Creater interface {
 	// creates a resource and stores the data in it, then returns the ID
-	Create(collection string, body *json.Decoder, query url.Values) (string, StorageStatusResponse)
+	Create(ctx context.Context, collection string, body *json.Decoder, query url.Values) (string, StorageStatusResponse)
+}
 
+// Getter is implemented by storages that can retrieve a single resource.
+type Getter interface {
 	// retrieves and returns a resource
-	Get(collection, id string, query url.Values) (interface{}, StorageStatusResponse)
+	Get(ctx context.Context, collection, id string, query url.Values) (interface{}, StorageStatusResponse)
+}
 
+// Lister is implemented by storages that can retrieve all resources in a collection.
+type Lister interface {
 	// retrieves and returns all resources in the specified collection
-	GetAll(collection string, query url.Values) ([]interface{}, StorageStatusResponse)
+	GetAll(ctx context.Context, collection string, query url.Values) ([]interface{}, StorageStatusResponse)
+}
 
+// Updater is implemented by storages that can update a resource.
+type Updater interface {
 	// updates a resource
-	Update(collection, id string, body *json.Decoder, query url.Values) StorageStatusResponse
+	Update(ctx context.Context, collection, id string, body *json.Decoder, query url.Values) StorageStatusResponse
+}
 
+// Deleter is implemented by storages that can delete a single resource.
+type Deleter interface {
 	// deletes a resource
-	Delete(collection, id string, query url.Values) StorageStatusResponse
+	Delete(ctx context.Context, collection, id string, query url.Values) StorageStatusResponse
+}
 
+// CollectionDeleter is implemented by storages that can delete all resources in a collection at once.
+type CollectionDeleter interface {
 	// delete all resources in a collection
-	DeleteAll(collection string, query url.Values) StorageStatusResponse
+	DeleteAll(ctx context.Context, collection string, query url.Values) StorageStatusResponse
 }
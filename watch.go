@@ -0,0 +1,281 @@
+package crudapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// heartbeatInterval is how often a comment is sent on an idle watch stream, to
+// keep the connection alive through proxies that time out idle connections.
+const heartbeatInterval = 15 * time.Second
+
+// brokerHistorySize is how many past events per collection the default broker
+// keeps around to serve Last-Event-ID resumption.
+const brokerHistorySize = 100
+
+// EventType describes what happened to a resource.
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+)
+
+// Event describes a single change to a resource, published to subscribers of
+// GET /{collection}/_watch.
+type Event struct {
+	id         uint64
+	Type       EventType   `json:"type"`
+	Collection string      `json:"collection"`
+	ResourceID string      `json:"id,omitempty"`
+	Resource   interface{} `json:"resource,omitempty"`
+	ETag       string      `json:"etag,omitempty"`
+}
+
+// Watchable is implemented by storages with a native change feed (e.g.
+// Postgres LOGICAL replication, a Mongo change stream) that want to serve
+// GET /{collection}/_watch themselves instead of relying on crudapi's default
+// in-process broker, which only sees changes made through this API.
+// Each event is written to the stream with Event's unexported id as its SSE
+// ID, which only the default broker sets; events from a Watchable declared
+// outside this package are all sent with the ID 0.
+type Watchable interface {
+	// Watch subscribes to changes on collection, resuming after sinceToken if
+	// non-empty (an opaque cursor as previously sent as an event's ID), and
+	// returns a channel of events, a function to cancel the subscription, and
+	// an error if the subscription could not be established.
+	Watch(collection string, sinceToken string) (events <-chan Event, cancel func(), err error)
+}
+
+// broker is the default, in-process Watchable used for storages that don't
+// implement it themselves. It fans out events published by the CRUD handlers
+// to every active subscriber of a collection.
+type broker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     map[string][]Event
+	subscribers map[string]map[chan Event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{
+		history:     make(map[string][]Event),
+		subscribers: make(map[string]map[chan Event]struct{}),
+	}
+}
+
+func (b *broker) publish(collection string, e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e.id = b.nextID
+	e.Collection = collection
+
+	hist := append(b.history[collection], e)
+	if len(hist) > brokerHistorySize {
+		hist = hist[len(hist)-brokerHistorySize:]
+	}
+	b.history[collection] = hist
+
+	for ch := range b.subscribers[collection] {
+		select {
+		case ch <- e:
+		default: // subscriber isn't keeping up; drop the event rather than block publishers
+		}
+	}
+}
+
+func (b *broker) Watch(collection, sinceToken string) (<-chan Event, func(), error) {
+	since := uint64(0)
+	if sinceToken != "" {
+		parsed, err := strconv.ParseUint(sinceToken, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("crudapi: invalid Last-Event-ID %q", sinceToken)
+		}
+		since = parsed
+	}
+
+	ch := make(chan Event, brokerHistorySize)
+
+	b.mu.Lock()
+	if b.subscribers[collection] == nil {
+		b.subscribers[collection] = make(map[chan Event]struct{})
+	}
+	b.subscribers[collection][ch] = struct{}{}
+
+	// Replay the backlog while still holding the lock, so a publish() racing
+	// with this subscription can't enqueue a newer event into ch before the
+	// backlog it should follow.
+	for _, e := range b.history[collection] {
+		if e.id > since {
+			ch <- e
+		}
+	}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		delete(b.subscribers[collection], ch)
+		b.mu.Unlock()
+	}
+
+	return ch, cancel, nil
+}
+
+// notifyFunc publishes a change event for the resource identified by
+// collection and id. It is a no-op when storage implements Watchable, since
+// the storage then drives its own feed.
+type notifyFunc func(ctx context.Context, collection, id string, eventType EventType)
+
+func noopNotify(context.Context, string, string, EventType) {}
+
+// newNotifier returns the notifyFunc New should call after a successful
+// mutation, and the default broker it should mount /{collection}/_watch on, if
+// any. If storage implements Watchable itself, no broker is created and
+// notifications are a no-op, since the storage drives its own feed.
+func newNotifier(storage Storage) (notifyFunc, *broker) {
+	if _, ok := storage.(Watchable); ok {
+		return noopNotify, nil
+	}
+
+	b := newBroker()
+
+	notify := func(ctx context.Context, collection, id string, eventType EventType) {
+		event := Event{Type: eventType, ResourceID: id}
+
+		if eventType != EventDeleted {
+			if getter, ok := storage.(Getter); ok {
+				if resource, resp := getter.Get(ctx, collection, id, url.Values{}); resp.StatusCode() == http.StatusOK {
+					event.Resource = resource
+				}
+			}
+		}
+
+		if versioned, ok := storage.(Versioned); ok {
+			if etag, ok := versioned.ETag(ctx, collection, id); ok {
+				event.ETag = etag
+			}
+		}
+
+		b.publish(collection, event)
+	}
+
+	return notify, b
+}
+
+// watch handles GET /{collection}/_watch: it serves an SSE stream of Event
+// values for the collection, using storage's own Watchable implementation if
+// it has one, or defaultBroker otherwise. Resumption is supported via the
+// Last-Event-ID header, and ?filter=field=value restricts the stream to events
+// whose resource has that field set to that value. Events whose resource is
+// not a JSON object, such as deletions, always pass the filter.
+func watch(storage Storage, defaultBroker *broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		collection := chi.URLParam(r, "collection")
+		sinceToken := r.Header.Get("Last-Event-ID")
+
+		var (
+			events <-chan Event
+			cancel func()
+			err    error
+		)
+
+		if watchable, ok := storage.(Watchable); ok {
+			events, cancel, err = watchable.Watch(collection, sinceToken)
+		} else {
+			events, cancel, err = defaultBroker.Watch(collection, sinceToken)
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer cancel()
+
+		filterField, filterValue := parseFilter(r.URL.Query())
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if filterField != "" && !matchesFilter(e, filterField, filterValue) {
+					continue
+				}
+				writeEvent(w, e)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func parseFilter(query url.Values) (field, value string) {
+	raw := query.Get("filter")
+	if raw == "" {
+		return "", ""
+	}
+
+	parts := strings.SplitN(raw, "=", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
+
+func matchesFilter(e Event, field, value string) bool {
+	resource, ok := e.Resource.(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	fieldValue, ok := resource[field]
+	if !ok {
+		return false
+	}
+
+	return fmt.Sprintf("%v", fieldValue) == value
+}
+
+func writeEvent(w http.ResponseWriter, e Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.Type, data)
+}
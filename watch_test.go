@@ -0,0 +1,69 @@
+package crudapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchStream(t *testing.T) {
+	storage := NewMapStorage()
+	storage.AddMap("artists")
+	srv := httptest.NewServer(New(storage))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/artists/_watch", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("watch stream: got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		create, err := http.Post(srv.URL+"/artists", "application/json", strings.NewReader(`{"name":"test"}`))
+		if err == nil {
+			create.Body.Close()
+		}
+	}()
+
+	reader := bufio.NewReader(resp.Body)
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := strings.TrimPrefix(line, "data: ")
+
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Type != EventCreated || e.Collection != "artists" {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+		return
+	}
+
+	t.Fatal("timed out waiting for an SSE event")
+}